@@ -0,0 +1,332 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultCAValidity is how long a CA-generated issuer certificate is
+	// valid for. The CA rolls it over defaultRenewBefore ahead of its
+	// NotAfter.
+	defaultCAValidity = 365 * 24 * time.Hour
+	// defaultRenewBefore is how far ahead of its issuer certificate's
+	// NotAfter a CA will proactively rotate to a freshly generated issuer.
+	defaultRenewBefore = 24 * time.Hour
+)
+
+// CA encapsulates an ephemeral issuer keypair and CA certificate used to
+// sign certificates issued for submission to CT logs. It automatically
+// regenerates its issuer keypair and certificate when the certificate's
+// NotAfter is within renewBefore of the CA's clock, so long-running
+// monitors never attempt to issue from an expired issuer. A CA is safe
+// for concurrent use.
+type CA struct {
+	subject     pkix.Name
+	keyProfile  KeyProfile
+	validity    time.Duration
+	renewBefore time.Duration
+	clk         clock.Clock
+	newSerial   SerialSource
+
+	rolloverCounter prometheus.Counter
+
+	// parent is the CA that signs this CA's issuer certificate. It is nil
+	// for a root CA created with NewCA, and set for an intermediate CA
+	// created with (*CA).NewIntermediate.
+	parent *CA
+
+	mu sync.Mutex
+
+	issuerKey  crypto.Signer
+	issuerCert *x509.Certificate
+	// parentCertAtRotation is the parent's issuerCert this CA's current
+	// issuerCert was signed against, used to detect that the parent has
+	// since rolled over to a new issuer and this CA must follow suit.
+	parentCertAtRotation *x509.Certificate
+}
+
+// Option configures a CA constructed with NewCA.
+type Option func(*CA)
+
+// WithValidity sets how long a CA-generated issuer certificate is valid
+// for. The default is 365 days.
+func WithValidity(validity time.Duration) Option {
+	return func(ca *CA) {
+		ca.validity = validity
+	}
+}
+
+// WithRenewBefore sets how far ahead of its issuer certificate's NotAfter
+// the CA proactively rotates to a freshly generated issuer. The default
+// is 24 hours.
+func WithRenewBefore(renewBefore time.Duration) Option {
+	return func(ca *CA) {
+		ca.renewBefore = renewBefore
+	}
+}
+
+// WithKeyProfile sets the KeyProfile used to generate both the CA's own
+// issuer key and the subject keys of certificates it issues. The default
+// is ECDSAP256.
+func WithKeyProfile(profile KeyProfile) Option {
+	return func(ca *CA) {
+		ca.keyProfile = profile
+	}
+}
+
+// WithClock sets the clock.Clock the CA uses to decide when its issuer
+// certificate is valid from and when it needs to roll over. The default
+// is clock.Default().
+func WithClock(clk clock.Clock) Option {
+	return func(ca *CA) {
+		ca.clk = clk
+	}
+}
+
+// WithSerialSource sets the SerialSource the CA uses to generate
+// certificate serial numbers, both for its own issuer certificate and for
+// leaves issued with IssueTestPair. IssueLeaf does not draw from it: the
+// leaf keeps the SerialNumber of the template it is given. The default draws serials
+// with RandSerial. Pass an *LRUSerialSource to guard against a monitor
+// accidentally issuing a colliding (issuer, serial) pair.
+func WithSerialSource(src SerialSource) Option {
+	return func(ca *CA) {
+		ca.newSerial = src
+	}
+}
+
+// WithRolloverCounter sets a Prometheus counter that the CA increments
+// each time it regenerates its issuer keypair and certificate.
+func WithRolloverCounter(counter prometheus.Counter) Option {
+	return func(ca *CA) {
+		ca.rolloverCounter = counter
+	}
+}
+
+// NewCA creates a CA for the given subject, applying any provided
+// Options, and generates its initial issuer keypair and self-signed CA
+// certificate.
+func NewCA(subject pkix.Name, opts ...Option) (*CA, error) {
+	ca := &CA{
+		subject:     subject,
+		keyProfile:  ECDSAP256,
+		validity:    defaultCAValidity,
+		renewBefore: defaultRenewBefore,
+		clk:         clock.Default(),
+		newSerial:   SerialSourceFunc(RandSerial),
+	}
+	for _, opt := range opts {
+		opt(ca)
+	}
+	if err := ca.forceRotate(); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// NewIntermediate creates a new CA whose issuer certificate is signed by
+// ca (the parent) rather than self-signed, applying any provided Options.
+// The returned CA's Chain includes the full path back to ca's root.
+func (ca *CA) NewIntermediate(subject pkix.Name, opts ...Option) (*CA, error) {
+	child := &CA{
+		subject:     subject,
+		keyProfile:  ca.keyProfile,
+		validity:    ca.validity,
+		renewBefore: ca.renewBefore,
+		clk:         ca.clk,
+		newSerial:   ca.newSerial,
+		parent:      ca,
+	}
+	for _, opt := range opts {
+		opt(child)
+	}
+	if err := child.forceRotate(); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// forceRotate locks ca and rotates it unconditionally.
+func (ca *CA) forceRotate() error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.rotateLocked()
+}
+
+// currentIssuer locks ca, rotating first if ca is near expiry or (for an
+// intermediate) if its parent has rolled over since ca last rotated, and
+// returns ca's current issuer certificate and key together so a caller
+// (including a child CA signing against ca as its parent) never observes
+// a torn certificate/key pairing.
+func (ca *CA) currentIssuer() (*x509.Certificate, crypto.Signer, error) {
+	_, cert, key, err := ca.chainAndIssuer()
+	return cert, key, err
+}
+
+// chainAndIssuer locks ca, rotating it and its ancestors first as
+// currentIssuer does, and returns the full chain of ancestor certificates
+// (root -> ... -> ca) alongside ca's own current issuer certificate and
+// key. Each ancestor's certificate is read exactly once, in the same
+// recursive pass that decides whether that ancestor needs to rotate, so
+// the returned chain is a single consistent snapshot: unlike re-reading
+// ca.issuerCert through a fresh lock after currentIssuer has already
+// returned and every lock has been released, there is no window for a
+// concurrent rotation to make the returned certificates stop chaining
+// together.
+func (ca *CA) chainAndIssuer() ([]*x509.Certificate, *x509.Certificate, crypto.Signer, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var ancestors []*x509.Certificate
+	var parentCert *x509.Certificate
+	var parentKey crypto.Signer
+	if ca.parent != nil {
+		var err error
+		ancestors, parentCert, parentKey, err = ca.parent.chainAndIssuer()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	needsRotate := ca.issuerCert == nil ||
+		!ca.clk.Now().Add(ca.renewBefore).Before(ca.issuerCert.NotAfter) ||
+		(ca.parent != nil && parentCert != ca.parentCertAtRotation)
+	if needsRotate {
+		if err := ca.rotateLockedWithParent(parentCert, parentKey); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return append(ancestors, ca.issuerCert), ca.issuerCert, ca.issuerKey, nil
+}
+
+// rotateLocked rotates ca, fetching its parent's current issuer first (if
+// any). The caller must hold ca.mu.
+func (ca *CA) rotateLocked() error {
+	var parentCert *x509.Certificate
+	var parentKey crypto.Signer
+	if ca.parent != nil {
+		var err error
+		parentCert, parentKey, err = ca.parent.currentIssuer()
+		if err != nil {
+			return err
+		}
+	}
+	return ca.rotateLockedWithParent(parentCert, parentKey)
+}
+
+// rotateLockedWithParent generates a fresh issuer keypair and CA
+// certificate, replacing any existing one, signing against parentCert and
+// parentKey if ca has a parent (self-signed otherwise). The caller must
+// hold ca.mu and, if ca.parent != nil, must have already fetched
+// parentCert/parentKey via ca.parent.currentIssuer() or
+// ca.parent.chainAndIssuer(). It increments the
+// rollover counter (if configured) when replacing an existing
+// certificate, but not on the CA's initial issuance.
+func (ca *CA) rotateLockedWithParent(parentCert *x509.Certificate, parentKey crypto.Signer) error {
+	isRollover := ca.issuerCert != nil
+
+	key, err := NewIssuerKey(ca.keyProfile)
+	if err != nil {
+		return err
+	}
+	serial, err := ca.newSerial.NewSerial()
+	if err != nil {
+		return err
+	}
+
+	notBefore := ca.clk.Now()
+	notAfter := notBefore.Add(ca.validity)
+	tmpl := &x509.Certificate{
+		Subject:               ca.subject,
+		SerialNumber:          serial,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	signTemplate, signKey := tmpl, key
+	if ca.parent != nil {
+		signTemplate, signKey = parentCert, parentKey
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, signTemplate, key.Public(), signKey)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return err
+	}
+
+	ca.issuerKey = key
+	ca.issuerCert = cert
+	ca.parentCertAtRotation = parentCert
+	if isRollover && ca.rolloverCounter != nil {
+		ca.rolloverCounter.Inc()
+	}
+	return nil
+}
+
+// IssuerCertificate returns the CA's current issuer certificate,
+// rotating first if it is near expiry.
+func (ca *CA) IssuerCertificate() (*x509.Certificate, error) {
+	cert, _, err := ca.currentIssuer()
+	return cert, err
+}
+
+// IssueLeaf rotates the CA's issuer keypair if necessary and then issues
+// a leaf certificate from template, signed by the CA's current issuer.
+// It generates a fresh subject key (using the CA's KeyProfile) and
+// returns it alongside the issued certificate.
+func (ca *CA) IssueLeaf(template *x509.Certificate) (*x509.Certificate, crypto.Signer, error) {
+	issuerCert, issuerKey, err := ca.currentIssuer()
+	if err != nil {
+		return nil, nil, err
+	}
+	subjectKey, err := NewSubjectKey(ca.keyProfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := IssueCertificate(subjectKey.Public(), issuerKey, issuerCert, template)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, subjectKey, nil
+}
+
+// IssueTestPair rotates the CA (and its ancestors) if necessary and then
+// issues a precertificate and matching final leaf-certificate under
+// baseDomain, as described by IssueTestCertificate, returning the full
+// issuer chain that should accompany their submission. leafProfile may be
+// nil to use the default single-CN certificate shape.
+func (ca *CA) IssueTestPair(baseDomain string, leafProfile *LeafProfile, windowStart, windowEnd *time.Time) (CertificatePair, IssuerChain, error) {
+	chain, err := ca.Chain()
+	if err != nil {
+		return CertificatePair{}, IssuerChain{}, err
+	}
+	pair, err := issueTestCertificatePair(baseDomain, ca.keyProfile, leafProfile, ca.newSerial, chain.Signer, chain.IssuingCert(), ca.clk, windowStart, windowEnd)
+	if err != nil {
+		return CertificatePair{}, IssuerChain{}, err
+	}
+	return pair, chain, nil
+}
+
+// Chain rotates the CA and its ancestors if necessary and returns the
+// full IssuerChain that should accompany a submission of a leaf the CA
+// issues: root -> intermediate(s) -> this CA's issuer certificate.
+func (ca *CA) Chain() (IssuerChain, error) {
+	certs, _, key, err := ca.chainAndIssuer()
+	if err != nil {
+		return IssuerChain{}, err
+	}
+	return IssuerChain{Certs: certs, Signer: key}, nil
+}
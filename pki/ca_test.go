@@ -0,0 +1,399 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testSubject builds a minimal pkix.Name for use as a CA's subject in tests.
+func testSubject(cn string) pkix.Name {
+	return pkix.Name{CommonName: cn}
+}
+
+func TestNewCAIssuesSelfSigned(t *testing.T) {
+	clk := clock.NewFake()
+	ca, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	cert, err := ca.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		t.Fatalf("expected root CA certificate to be self-signed: %s", err)
+	}
+}
+
+func TestCARolloverOnExpiry(t *testing.T) {
+	clk := clock.NewFake()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_rollovers"})
+	ca, err := NewCA(testSubject("root"),
+		WithClock(clk),
+		WithValidity(10*24*time.Hour),
+		WithRenewBefore(24*time.Hour),
+		WithRolloverCounter(counter),
+	)
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+
+	first, err := ca.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if testutil.ToFloat64(counter) != 0 {
+		t.Fatal("expected no rollover to have occurred on initial issuance")
+	}
+
+	// Advance the clock to just inside the renewBefore window: the next
+	// call should rotate to a fresh issuer certificate.
+	clk.Add(10*24*time.Hour - time.Hour)
+	second, err := ca.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if second.SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Fatal("expected a fresh issuer certificate once within renewBefore of expiry")
+	}
+	if testutil.ToFloat64(counter) != 1 {
+		t.Fatalf("expected exactly one rollover, got %v", testutil.ToFloat64(counter))
+	}
+
+	// A call well before expiry should not rotate again.
+	third, err := ca.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if third.SerialNumber.Cmp(second.SerialNumber) != 0 {
+		t.Fatal("expected issuer certificate to be stable when not near expiry")
+	}
+	if testutil.ToFloat64(counter) != 1 {
+		t.Fatalf("expected rollover count to remain 1, got %v", testutil.ToFloat64(counter))
+	}
+}
+
+func TestNewIntermediateRollsOverWithParent(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"),
+		WithClock(clk),
+		WithValidity(10*24*time.Hour),
+		WithRenewBefore(24*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	intermediate, err := root.NewIntermediate(testSubject("intermediate"),
+		WithValidity(30*24*time.Hour),
+		WithRenewBefore(24*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+
+	firstIntermediateCert, err := intermediate.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	firstRootCert, err := root.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if err := firstIntermediateCert.CheckSignatureFrom(firstRootCert); err != nil {
+		t.Fatalf("expected intermediate to be signed by root: %s", err)
+	}
+
+	// Advance the clock far enough to roll over the root but not the
+	// intermediate on its own schedule; the intermediate must still
+	// follow, since it was signed by the root's now-stale certificate.
+	clk.Add(10*24*time.Hour - time.Hour)
+
+	secondRootCert, err := root.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if secondRootCert.SerialNumber.Cmp(firstRootCert.SerialNumber) == 0 {
+		t.Fatal("expected root to roll over")
+	}
+
+	secondIntermediateCert, err := intermediate.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+	if secondIntermediateCert.SerialNumber.Cmp(firstIntermediateCert.SerialNumber) == 0 {
+		t.Fatal("expected intermediate to roll over once its parent rolled over")
+	}
+	if err := secondIntermediateCert.CheckSignatureFrom(secondRootCert); err != nil {
+		t.Fatalf("expected rolled-over intermediate to be signed by rolled-over root: %s", err)
+	}
+}
+
+func TestChainOrdersRootToLeafIssuer(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	intermediate, err := root.NewIntermediate(testSubject("intermediate"))
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+	leafCA, err := intermediate.NewIntermediate(testSubject("leaf-issuer"))
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+
+	chain, err := leafCA.Chain()
+	if err != nil {
+		t.Fatalf("Chain returned error: %s", err)
+	}
+	if len(chain.Certs) != 3 {
+		t.Fatalf("expected a 3-certificate chain, got %d", len(chain.Certs))
+	}
+	if chain.Certs[0].Subject.CommonName != "root" {
+		t.Fatalf("expected chain[0] to be the root, got %q", chain.Certs[0].Subject.CommonName)
+	}
+	if chain.Certs[2].Subject.CommonName != "leaf-issuer" {
+		t.Fatalf("expected chain[2] to be the signing issuer, got %q", chain.Certs[2].Subject.CommonName)
+	}
+	for i := 1; i < len(chain.Certs); i++ {
+		if err := chain.Certs[i].CheckSignatureFrom(chain.Certs[i-1]); err != nil {
+			t.Fatalf("chain[%d] does not validate against chain[%d]: %s", i, i-1, err)
+		}
+	}
+}
+
+func TestIssueLeaf(t *testing.T) {
+	clk := clock.NewFake()
+	ca, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	issuerCert, err := ca.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+
+	serial, err := RandSerial()
+	if err != nil {
+		t.Fatalf("RandSerial returned error: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "leaf.test"},
+		NotBefore:    clk.Now(),
+		NotAfter:     clk.Now().Add(24 * time.Hour),
+	}
+	cert, _, err := ca.IssueLeaf(tmpl)
+	if err != nil {
+		t.Fatalf("IssueLeaf returned error: %s", err)
+	}
+	if err := cert.CheckSignatureFrom(issuerCert); err != nil {
+		t.Fatalf("expected leaf to be signed by CA's issuer: %s", err)
+	}
+}
+
+// fixedSerialSource is a SerialSource stub that always returns serial and
+// counts how many times NewSerial was called, so tests can tell whether a
+// leaf issuance path actually consulted the CA's configured SerialSource.
+type fixedSerialSource struct {
+	serial *big.Int
+	calls  int
+}
+
+func (f *fixedSerialSource) NewSerial() (*big.Int, error) {
+	f.calls++
+	return f.serial, nil
+}
+
+func TestIssueTestPairUsesConfiguredSerialSource(t *testing.T) {
+	clk := clock.NewFake()
+	src := &fixedSerialSource{serial: new(big.Int).Lsh(big.NewInt(424242), 64)}
+	ca, err := NewCA(testSubject("root"), WithClock(clk), WithSerialSource(src))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	// NewCA's own issuer certificate consumes one draw from src.
+	if src.calls != 1 {
+		t.Fatalf("expected 1 call to NewSerial after NewCA, got %d", src.calls)
+	}
+
+	pair, _, err := ca.IssueTestPair("", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("IssueTestPair returned error: %s", err)
+	}
+	if pair.Cert.SerialNumber.Cmp(src.serial) != 0 {
+		t.Fatalf("expected leaf serial %s drawn from configured SerialSource, got %s", src.serial, pair.Cert.SerialNumber)
+	}
+	if pair.PreCert.SerialNumber.Cmp(src.serial) != 0 {
+		t.Fatalf("expected precert serial %s drawn from configured SerialSource, got %s", src.serial, pair.PreCert.SerialNumber)
+	}
+	if src.calls != 2 {
+		t.Fatalf("expected IssueTestPair to draw exactly one more serial (shared by precert and cert), got %d total calls", src.calls)
+	}
+}
+
+// TestConcurrentChainAndIssueLeafDuringRollover is a regression test for the
+// data race fixed across "Fix stale parent cert and data race in CA
+// rollover" and "build Chain() from a single recursive snapshot...": many
+// goroutines repeatedly call Chain(), IssuerCertificate(), and IssueLeaf()
+// on a multi-level CA hierarchy while another goroutine drives the shared
+// fake clock through several rollover boundaries. Run with -race, this
+// catches unsynchronized field access; checking each returned chain's
+// signatures catches a torn read slipping through even without -race.
+func TestConcurrentChainAndIssueLeafDuringRollover(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"),
+		WithClock(clk),
+		WithValidity(2*time.Hour),
+		WithRenewBefore(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	intermediate, err := root.NewIntermediate(testSubject("intermediate"),
+		WithValidity(90*time.Minute),
+		WithRenewBefore(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+	leafCA, err := intermediate.NewIntermediate(testSubject("leaf-issuer"),
+		WithValidity(30*time.Minute),
+		WithRenewBefore(20*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+
+	var failed atomic.Bool
+	var chainCalls, issuerCalls, issueCalls atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			chain, err := leafCA.Chain()
+			if err != nil {
+				t.Errorf("Chain returned error: %s", err)
+				failed.Store(true)
+				return
+			}
+			for i := 1; i < len(chain.Certs); i++ {
+				if err := chain.Certs[i].CheckSignatureFrom(chain.Certs[i-1]); err != nil {
+					t.Errorf("chain[%d] does not validate against chain[%d]: %s", i, i-1, err)
+					failed.Store(true)
+					return
+				}
+			}
+			chainCalls.Add(1)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := leafCA.IssuerCertificate(); err != nil {
+				t.Errorf("IssuerCertificate returned error: %s", err)
+				failed.Store(true)
+				return
+			}
+			issuerCalls.Add(1)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			issuerCert, err := leafCA.IssuerCertificate()
+			if err != nil {
+				t.Errorf("IssuerCertificate returned error: %s", err)
+				failed.Store(true)
+				return
+			}
+			serial, err := RandSerial()
+			if err != nil {
+				t.Errorf("RandSerial returned error: %s", err)
+				failed.Store(true)
+				return
+			}
+			tmpl := &x509.Certificate{
+				SerialNumber: serial,
+				Subject:      pkix.Name{CommonName: "leaf.test"},
+				NotBefore:    clk.Now(),
+				NotAfter:     clk.Now().Add(time.Minute),
+			}
+			cert, _, err := leafCA.IssueLeaf(tmpl)
+			if err != nil {
+				t.Errorf("IssueLeaf returned error: %s", err)
+				failed.Store(true)
+				return
+			}
+			// issuerCert and cert were fetched/issued via two separate
+			// currentIssuer() calls, so a rollover could fall between
+			// them; only check the signature when they still agree on
+			// the issuer that was current at the time of issuance.
+			if cert.CheckSignatureFrom(issuerCert) != nil {
+				if latest, err := leafCA.IssuerCertificate(); err == nil && latest.Equal(issuerCert) {
+					t.Errorf("leaf does not validate against the issuer certificate that was current throughout issuance")
+					failed.Store(true)
+					return
+				}
+			}
+			issueCalls.Add(1)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			clk.Add(15 * time.Minute)
+			// Yield between ticks so the reader/issuer goroutines above
+			// actually get scheduled against each rollover boundary
+			// instead of this loop racing to completion and closing
+			// stop before they run a single iteration.
+			runtime.Gosched()
+			time.Sleep(time.Microsecond)
+		}
+		close(stop)
+	}()
+
+	wg.Wait()
+	if failed.Load() {
+		t.Fatal("concurrent rollover regression test observed an inconsistency")
+	}
+	if chainCalls.Load() == 0 || issuerCalls.Load() == 0 || issueCalls.Load() == 0 {
+		t.Fatalf("expected all worker goroutines to run at least once, got chain=%d issuer=%d issue=%d",
+			chainCalls.Load(), issuerCalls.Load(), issueCalls.Load())
+	}
+}
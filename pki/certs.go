@@ -5,15 +5,16 @@ package pki
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
 	"errors"
-	"math"
-	"math/big"
+	"fmt"
 	"time"
 
 	"github.com/jmhodges/clock"
@@ -44,30 +45,78 @@ var (
 	}
 )
 
-// RandSerial generates a random *bigInt to use as a certificate serial or
-// returns an error.
-func RandSerial() (*big.Int, error) {
-	serial, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
-	if err != nil {
-		return nil, err
+// KeyProfile identifies the algorithm and size used to generate a subject
+// or issuer private key with NewSubjectKey/NewIssuerKey.
+type KeyProfile int
+
+const (
+	// ECDSAP256 generates an ECDSA P-256 private key. This is the profile
+	// woodpecker used exclusively before KeyProfile was introduced.
+	ECDSAP256 KeyProfile = iota
+	// ECDSAP384 generates an ECDSA P-384 private key.
+	ECDSAP384
+	// RSA2048 generates an RSA 2048 bit private key.
+	RSA2048
+	// RSA3072 generates an RSA 3072 bit private key.
+	RSA3072
+	// RSA4096 generates an RSA 4096 bit private key.
+	RSA4096
+	// Ed25519 generates an Ed25519 private key.
+	Ed25519
+)
+
+// newKey generates a new private key using the algorithm and size indicated
+// by profile.
+func newKey(profile KeyProfile) (crypto.Signer, error) {
+	switch profile {
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case RSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("pki: unknown KeyProfile %d", profile)
 	}
-	return serial, nil
 }
 
-// RandKey generates a random ECDSA private key or returns an error.
+// NewSubjectKey generates a new private key suitable for use as a
+// certificate subject key, using the algorithm and size indicated by
+// profile.
+func NewSubjectKey(profile KeyProfile) (crypto.Signer, error) {
+	return newKey(profile)
+}
+
+// NewIssuerKey generates a new private key suitable for use as a
+// certificate issuer key, using the algorithm and size indicated by
+// profile.
+func NewIssuerKey(profile KeyProfile) (crypto.Signer, error) {
+	return newKey(profile)
+}
+
+// RandKey generates a random ECDSA P-256 private key or returns an error.
+//
+// Deprecated: use NewSubjectKey with an explicit KeyProfile instead.
 func RandKey() (*ecdsa.PrivateKey, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := NewSubjectKey(ECDSAP256)
 	if err != nil {
 		return nil, err
 	}
-	return key, nil
+	return key.(*ecdsa.PrivateKey), nil
 }
 
 // IssueCertificate uses the provided issuerKey and issuerCert to issue a new
 // X509 Certificate with the provided subjectKey based on the provided template.
 func IssueCertificate(
 	subjectKey crypto.PublicKey,
-	issuerKey *ecdsa.PrivateKey,
+	issuerKey crypto.Signer,
 	issuerCert, template *x509.Certificate) (*x509.Certificate, error) {
 	if subjectKey == nil {
 		return nil, errNilSubjKey
@@ -117,13 +166,62 @@ type CertificatePair struct {
 // If windowStart and windowEnd are not nil then issue a 90 day
 // certificate that falls in the window.
 //
+// keyProfile selects the subject key algorithm used for the returned
+// certificate pair (see KeyProfile).
+//
+// leafProfile, if non-nil, customizes the issued certificates' SANs, EKUs,
+// and extra extensions (see LeafProfile). If leafProfile is nil, or its
+// Hosts field is empty, the historical behavior of a single DNS SAN
+// derived from the certificate serial is used.
+//
+// chain supplies the issuer: its IssuingCert and Signer directly sign the
+// leaf certificates, and chain is returned unchanged so callers can pass
+// it straight through to an add-chain/add-pre-chain submission alongside
+// the returned CertificatePair. chain must contain at least one
+// certificate, or errEmptyIssuerChain is returned.
+//
+// IssueTestCertificate is a thin wrapper around a one-shot CA built from
+// chain: it performs no rollover of its own, since chain's issuer is only
+// ever used for this single call.
+//
 // This function creates certificates that will be submitted to public
 // logs and so while they are not issued by a trusted root  we try to
 // avoid cablint errors to avoid requiring log monitors special-case our
 // submissions.
 func IssueTestCertificate(
 	baseDomain string,
-	issuerKey *ecdsa.PrivateKey,
+	keyProfile KeyProfile,
+	leafProfile *LeafProfile,
+	chain IssuerChain,
+	clk clock.Clock,
+	windowStart *time.Time,
+	windowEnd *time.Time) (CertificatePair, IssuerChain, error) {
+	if len(chain.Certs) == 0 {
+		return CertificatePair{}, IssuerChain{}, errEmptyIssuerChain
+	}
+
+	oneShotCA := &CA{
+		keyProfile: keyProfile,
+		clk:        clk,
+		newSerial:  SerialSourceFunc(RandSerial),
+		issuerKey:  chain.Signer,
+		issuerCert: chain.IssuingCert(),
+	}
+	pair, err := issueTestCertificatePair(baseDomain, oneShotCA.keyProfile, leafProfile, oneShotCA.newSerial, oneShotCA.issuerKey, oneShotCA.issuerCert, oneShotCA.clk, windowStart, windowEnd)
+	if err != nil {
+		return CertificatePair{}, IssuerChain{}, err
+	}
+	return pair, chain, nil
+}
+
+// issueTestCertificatePair holds the shared precert/final-cert issuance
+// logic used by both IssueTestCertificate and (*CA).IssueTestPair.
+func issueTestCertificatePair(
+	baseDomain string,
+	keyProfile KeyProfile,
+	leafProfile *LeafProfile,
+	newSerial SerialSource,
+	issuerKey crypto.Signer,
 	issuerCert *x509.Certificate,
 	clk clock.Clock,
 	windowStart *time.Time,
@@ -134,12 +232,15 @@ func IssueTestCertificate(
 	if baseDomain[0] != '.' {
 		return CertificatePair{}, errBadBaseDomain
 	}
+	if err := validateLeafProfile(leafProfile); err != nil {
+		return CertificatePair{}, err
+	}
 
-	certKey, err := RandKey()
+	certKey, err := NewSubjectKey(keyProfile)
 	if err != nil {
 		return CertificatePair{}, err
 	}
-	serial, err := RandSerial()
+	serial, err := newSerial.NewSerial()
 	if err != nil {
 		return CertificatePair{}, err
 	}
@@ -179,8 +280,19 @@ func IssueTestCertificate(
 			IssuingCertificateURL: []string{"http://issuer" + baseDomain},
 			CRLDistributionPoints: []string{"http://crls" + baseDomain},
 		}
+		if leafProfile != nil && len(leafProfile.Hosts) > 0 {
+			tmpl.Subject.CommonName = ""
+			tmpl.DNSNames = nil
+			applyHosts(tmpl, leafProfile.Hosts)
+		}
+		if leafProfile != nil && len(leafProfile.ExtKeyUsages) > 0 {
+			tmpl.ExtKeyUsage = leafProfile.ExtKeyUsages
+		}
+		if leafProfile != nil {
+			tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, leafProfile.ExtraExtensions...)
+		}
 		if precert {
-			tmpl.ExtraExtensions = []pkix.Extension{ctPoisonExtension}
+			tmpl.ExtraExtensions = append(tmpl.ExtraExtensions, ctPoisonExtension)
 		}
 		return IssueCertificate(certKey.Public(), issuerKey, issuerCert, tmpl)
 	}
@@ -0,0 +1,210 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"testing"
+
+	"github.com/jmhodges/clock"
+)
+
+func TestNewSubjectKeyProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile KeyProfile
+		check   func(t *testing.T, key crypto.Signer)
+	}{
+		{"ECDSAP256", ECDSAP256, func(t *testing.T, key crypto.Signer) {
+			k, ok := key.(*ecdsa.PrivateKey)
+			if !ok || k.Curve.Params().BitSize != 256 {
+				t.Fatalf("expected P-256 ECDSA key, got %T", key)
+			}
+		}},
+		{"ECDSAP384", ECDSAP384, func(t *testing.T, key crypto.Signer) {
+			k, ok := key.(*ecdsa.PrivateKey)
+			if !ok || k.Curve.Params().BitSize != 384 {
+				t.Fatalf("expected P-384 ECDSA key, got %T", key)
+			}
+		}},
+		{"RSA2048", RSA2048, func(t *testing.T, key crypto.Signer) {
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok || k.N.BitLen() != 2048 {
+				t.Fatalf("expected 2048 bit RSA key, got %T", key)
+			}
+		}},
+		{"RSA3072", RSA3072, func(t *testing.T, key crypto.Signer) {
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok || k.N.BitLen() != 3072 {
+				t.Fatalf("expected 3072 bit RSA key, got %T", key)
+			}
+		}},
+		{"RSA4096", RSA4096, func(t *testing.T, key crypto.Signer) {
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok || k.N.BitLen() != 4096 {
+				t.Fatalf("expected 4096 bit RSA key, got %T", key)
+			}
+		}},
+		{"Ed25519", Ed25519, func(t *testing.T, key crypto.Signer) {
+			if _, ok := key.(ed25519.PrivateKey); !ok {
+				t.Fatalf("expected ed25519.PrivateKey, got %T", key)
+			}
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := NewSubjectKey(tc.profile)
+			if err != nil {
+				t.Fatalf("NewSubjectKey(%v) returned error: %s", tc.profile, err)
+			}
+			tc.check(t, key)
+
+			issuerKey, err := NewIssuerKey(tc.profile)
+			if err != nil {
+				t.Fatalf("NewIssuerKey(%v) returned error: %s", tc.profile, err)
+			}
+			tc.check(t, issuerKey)
+		})
+	}
+}
+
+func TestNewSubjectKeyUnknownProfile(t *testing.T) {
+	if _, err := NewSubjectKey(KeyProfile(999)); err == nil {
+		t.Fatal("expected error for unknown KeyProfile, got nil")
+	}
+}
+
+func TestRandKeyBackwardsCompatible(t *testing.T) {
+	key, err := RandKey()
+	if err != nil {
+		t.Fatalf("RandKey returned error: %s", err)
+	}
+	if key.Curve.Params().BitSize != 256 {
+		t.Fatalf("expected RandKey to return a P-256 ECDSA key, got bit size %d", key.Curve.Params().BitSize)
+	}
+}
+
+func TestIssueCertificateNilArgs(t *testing.T) {
+	subjectKey, err := NewSubjectKey(ECDSAP256)
+	if err != nil {
+		t.Fatalf("NewSubjectKey returned error: %s", err)
+	}
+	issuerKey, err := NewIssuerKey(ECDSAP256)
+	if err != nil {
+		t.Fatalf("NewIssuerKey returned error: %s", err)
+	}
+	issuerCert := selfSignedTestCA(t, issuerKey)
+	template := &x509.Certificate{
+		SerialNumber: issuerCert.SerialNumber,
+		Subject:      pkix.Name{CommonName: "leaf.test"},
+	}
+
+	tests := []struct {
+		name       string
+		subjectKey crypto.PublicKey
+		issuerKey  crypto.Signer
+		issuerCert *x509.Certificate
+		template   *x509.Certificate
+		wantErr    error
+	}{
+		{"nil subject key", nil, issuerKey, issuerCert, template, errNilSubjKey},
+		{"nil issuer key", subjectKey.Public(), nil, issuerCert, template, errNilIssuerKey},
+		{"nil issuer cert", subjectKey.Public(), issuerKey, nil, template, errNilIssuerCert},
+		{"nil template", subjectKey.Public(), issuerKey, issuerCert, nil, errNilTemplate},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := IssueCertificate(tc.subjectKey, tc.issuerKey, tc.issuerCert, tc.template)
+			if err != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestIssueTestCertificateEachKeyProfile(t *testing.T) {
+	profiles := []KeyProfile{ECDSAP256, ECDSAP384, RSA2048, RSA3072, RSA4096, Ed25519}
+	clk := clock.NewFake()
+
+	for _, profile := range profiles {
+		profile := profile
+		t.Run(fmt.Sprintf("profile_%d", profile), func(t *testing.T) {
+			root, err := NewCA(testSubject("root"), WithClock(clk))
+			if err != nil {
+				t.Fatalf("NewCA returned error: %s", err)
+			}
+			chain, err := root.Chain()
+			if err != nil {
+				t.Fatalf("Chain returned error: %s", err)
+			}
+			pair, gotChain, err := IssueTestCertificate("", profile, nil, chain, clk, nil, nil)
+			if err != nil {
+				t.Fatalf("IssueTestCertificate(%v) returned error: %s", profile, err)
+			}
+			if pair.PreCert == nil || pair.Cert == nil {
+				t.Fatal("expected non-nil PreCert and Cert")
+			}
+			if pair.PreCert.Subject.CommonName != pair.Cert.Subject.CommonName {
+				t.Fatal("expected precert and cert to share a common name")
+			}
+			if err := pair.Cert.CheckSignatureFrom(gotChain.IssuingCert()); err != nil {
+				t.Fatalf("Cert does not chain to issuer: %s", err)
+			}
+		})
+	}
+}
+
+func TestIssueTestCertificateEmptyChain(t *testing.T) {
+	clk := clock.NewFake()
+	_, _, err := IssueTestCertificate("", ECDSAP256, nil, IssuerChain{}, clk, nil, nil)
+	if err != errEmptyIssuerChain {
+		t.Fatalf("expected errEmptyIssuerChain, got %v", err)
+	}
+}
+
+func TestIssueTestCertificateBadBaseDomain(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	chain, err := root.Chain()
+	if err != nil {
+		t.Fatalf("Chain returned error: %s", err)
+	}
+	if _, _, err := IssueTestCertificate("no-leading-dot", ECDSAP256, nil, chain, clk, nil, nil); err != errBadBaseDomain {
+		t.Fatalf("expected errBadBaseDomain, got %v", err)
+	}
+}
+
+// selfSignedTestCA issues a minimal self-signed CA certificate for key, for
+// use as an issuerCert in tests that don't need a full (*CA).
+func selfSignedTestCA(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+	serial, err := RandSerial()
+	if err != nil {
+		t.Fatalf("RandSerial returned error: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "test CA"},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate returned error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate returned error: %s", err)
+	}
+	return cert
+}
@@ -0,0 +1,39 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+)
+
+var errEmptyIssuerChain = errors.New("pki: IssuerChain must contain at least one certificate")
+
+// IssuerChain holds the ordered certificates, and the signer for the last
+// of them, that should accompany an add-chain/add-pre-chain submission:
+// root -> intermediate(s) -> signing issuer.
+type IssuerChain struct {
+	// Certs holds the chain's certificates, ordered from root to the
+	// signing issuer (the certificate that directly issues leaves).
+	Certs []*x509.Certificate
+	// Signer is the private key corresponding to the last entry of Certs.
+	Signer crypto.Signer
+}
+
+// NewIssuerChain builds an IssuerChain from explicit root -> intermediate(s)
+// -> signing issuer certificates and the signer corresponding to the last
+// (signing issuer) certificate.
+func NewIssuerChain(signer crypto.Signer, certs ...*x509.Certificate) (IssuerChain, error) {
+	if len(certs) == 0 {
+		return IssuerChain{}, errEmptyIssuerChain
+	}
+	if signer == nil {
+		return IssuerChain{}, errNilIssuerKey
+	}
+	return IssuerChain{Certs: certs, Signer: signer}, nil
+}
+
+// IssuingCert returns the chain's signing issuer certificate: the
+// certificate that directly issues leaf certificates.
+func (c IssuerChain) IssuingCert() *x509.Certificate {
+	return c.Certs[len(c.Certs)-1]
+}
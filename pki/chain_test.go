@@ -0,0 +1,70 @@
+package pki
+
+import (
+	"testing"
+
+	"github.com/jmhodges/clock"
+)
+
+func TestNewIssuerChainValidation(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	cert, err := root.IssuerCertificate()
+	if err != nil {
+		t.Fatalf("IssuerCertificate returned error: %s", err)
+	}
+
+	if _, err := NewIssuerChain(nil, cert); err != errNilIssuerKey {
+		t.Fatalf("expected errNilIssuerKey for nil signer, got %v", err)
+	}
+
+	signer, err := NewIssuerKey(ECDSAP256)
+	if err != nil {
+		t.Fatalf("NewIssuerKey returned error: %s", err)
+	}
+	if _, err := NewIssuerChain(signer); err != errEmptyIssuerChain {
+		t.Fatalf("expected errEmptyIssuerChain for no certs, got %v", err)
+	}
+
+	chain, err := NewIssuerChain(signer, cert)
+	if err != nil {
+		t.Fatalf("NewIssuerChain returned error: %s", err)
+	}
+	if chain.IssuingCert() != cert {
+		t.Fatal("expected IssuingCert to return the last (only) certificate")
+	}
+}
+
+func TestIntermediateChainValidity(t *testing.T) {
+	clk := clock.NewFake()
+	root, err := NewCA(testSubject("root"), WithClock(clk))
+	if err != nil {
+		t.Fatalf("NewCA returned error: %s", err)
+	}
+	intermediate, err := root.NewIntermediate(testSubject("intermediate"))
+	if err != nil {
+		t.Fatalf("NewIntermediate returned error: %s", err)
+	}
+
+	chain, err := intermediate.Chain()
+	if err != nil {
+		t.Fatalf("Chain returned error: %s", err)
+	}
+	if len(chain.Certs) != 2 {
+		t.Fatalf("expected a 2-certificate chain, got %d", len(chain.Certs))
+	}
+
+	rootCert, intermediateCert := chain.Certs[0], chain.Certs[1]
+	if err := rootCert.CheckSignatureFrom(rootCert); err != nil {
+		t.Fatalf("expected root certificate to be self-signed: %s", err)
+	}
+	if err := intermediateCert.CheckSignatureFrom(rootCert); err != nil {
+		t.Fatalf("expected intermediate to chain-validate against root: %s", err)
+	}
+	if chain.IssuingCert() != intermediateCert {
+		t.Fatal("expected IssuingCert to return the intermediate's certificate")
+	}
+}
@@ -0,0 +1,73 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/mail"
+	"net/url"
+)
+
+var errDuplicatePoisonExtension = errors.New("pki: LeafProfile.ExtraExtensions must not include the CT poison extension")
+
+// LeafProfile customizes the certificate template used by
+// IssueTestCertificate and (*CA).IssueTestPair, letting a caller probe
+// logs with certificate shapes beyond the default single-CN profile.
+type LeafProfile struct {
+	// Hosts, if non-empty, replaces the default single DNS SAN generated
+	// from the certificate serial. Each entry is classified (in order) as
+	// an IP address, an email address, a URI, or else a DNS name, and
+	// appended to the corresponding SAN field. The certificate's subject
+	// common name is set to the first DNS name, if any.
+	Hosts []string
+
+	// ExtKeyUsages, if non-empty, replaces the default
+	// [x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth].
+	ExtKeyUsages []x509.ExtKeyUsage
+
+	// ExtraExtensions are appended to the certificate's extensions. It is
+	// an error for an entry to reuse the CT poison extension's OID; the
+	// poison extension is added automatically on the precertificate.
+	ExtraExtensions []pkix.Extension
+}
+
+// applyHosts classifies each entry of hosts as an IP address, an email
+// address, a URI, or else a DNS name (the same precedence used by the
+// OverrideHosts helpers elsewhere in the CT ecosystem) and populates the
+// corresponding SAN slice of tmpl.
+func applyHosts(tmpl *x509.Certificate, hosts []string) {
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			continue
+		}
+		if _, err := mail.ParseAddress(host); err == nil {
+			tmpl.EmailAddresses = append(tmpl.EmailAddresses, host)
+			continue
+		}
+		if u, err := url.Parse(host); err == nil && u.Scheme != "" && u.Host != "" {
+			tmpl.URIs = append(tmpl.URIs, u)
+			continue
+		}
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	if len(tmpl.DNSNames) > 0 {
+		tmpl.Subject.CommonName = tmpl.DNSNames[0]
+	}
+}
+
+// validateLeafProfile returns an error if profile's ExtraExtensions
+// duplicate the CT poison extension, which IssueTestCertificate adds
+// automatically on the precertificate.
+func validateLeafProfile(profile *LeafProfile) error {
+	if profile == nil {
+		return nil
+	}
+	for _, ext := range profile.ExtraExtensions {
+		if ext.Id.Equal(ctPoisonExtensionID) {
+			return errDuplicatePoisonExtension
+		}
+	}
+	return nil
+}
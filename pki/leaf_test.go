@@ -0,0 +1,62 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestApplyHosts(t *testing.T) {
+	tmpl := &x509.Certificate{}
+	applyHosts(tmpl, []string{
+		"192.0.2.1",
+		"user@example.com",
+		"https://example.com/path",
+		"www.example.com",
+		"mail.example.com",
+	})
+
+	if len(tmpl.IPAddresses) != 1 || tmpl.IPAddresses[0].String() != "192.0.2.1" {
+		t.Fatalf("expected one IP SAN, got %v", tmpl.IPAddresses)
+	}
+	if len(tmpl.EmailAddresses) != 1 || tmpl.EmailAddresses[0] != "user@example.com" {
+		t.Fatalf("expected one email SAN, got %v", tmpl.EmailAddresses)
+	}
+	if len(tmpl.URIs) != 1 || tmpl.URIs[0].String() != "https://example.com/path" {
+		t.Fatalf("expected one URI SAN, got %v", tmpl.URIs)
+	}
+	if len(tmpl.DNSNames) != 2 || tmpl.DNSNames[0] != "www.example.com" || tmpl.DNSNames[1] != "mail.example.com" {
+		t.Fatalf("expected two DNS SANs in order, got %v", tmpl.DNSNames)
+	}
+	if tmpl.Subject.CommonName != "www.example.com" {
+		t.Fatalf("expected CommonName to be set to the first DNS name, got %q", tmpl.Subject.CommonName)
+	}
+}
+
+func TestApplyHostsNoDNSNames(t *testing.T) {
+	tmpl := &x509.Certificate{}
+	applyHosts(tmpl, []string{"192.0.2.1"})
+	if tmpl.Subject.CommonName != "" {
+		t.Fatalf("expected CommonName to be left unset with no DNS SANs, got %q", tmpl.Subject.CommonName)
+	}
+}
+
+func TestValidateLeafProfile(t *testing.T) {
+	if err := validateLeafProfile(nil); err != nil {
+		t.Fatalf("expected nil profile to be valid, got %s", err)
+	}
+
+	okProfile := &LeafProfile{
+		ExtraExtensions: []pkix.Extension{{Id: []int{1, 2, 3}}},
+	}
+	if err := validateLeafProfile(okProfile); err != nil {
+		t.Fatalf("expected non-conflicting extension to be valid, got %s", err)
+	}
+
+	badProfile := &LeafProfile{
+		ExtraExtensions: []pkix.Extension{{Id: ctPoisonExtensionID}},
+	}
+	if err := validateLeafProfile(badProfile); err != errDuplicatePoisonExtension {
+		t.Fatalf("expected errDuplicatePoisonExtension, got %v", err)
+	}
+}
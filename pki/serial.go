@@ -0,0 +1,142 @@
+package pki
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	"sync"
+)
+
+const (
+	// defaultSerialBits is the number of bits of entropy RandSerial draws.
+	// 128 bits matches the serial size used by most publicly trusted CAs
+	// and comfortably exceeds the 64-bit minimum required by the CA/Browser
+	// Forum Baseline Requirements.
+	defaultSerialBits = 128
+	// maxSerialOctets is the maximum number of content octets a certificate
+	// serial number's DER encoding may occupy, per RFC 5280 §4.1.2.2.
+	maxSerialOctets = 20
+	// defaultSerialLRUSize is the default number of recently-issued serials
+	// an LRUSerialSource remembers before forgetting the oldest.
+	defaultSerialLRUSize = 10_000
+)
+
+// RandSerial generates a random, positive serial number to use as a
+// certificate serial with defaultSerialBits bits of entropy, or returns an
+// error.
+func RandSerial() (*big.Int, error) {
+	return RandSerialBits(defaultSerialBits)
+}
+
+// RandSerialBits generates a random, positive serial number with the given
+// number of bits of entropy, redrawing if zero or if its DER encoding
+// would exceed the 20 octet limit imposed by RFC 5280 §4.1.2.2.
+func RandSerialBits(bits int) (*big.Int, error) {
+	upperBound := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	for {
+		serial, err := rand.Int(rand.Reader, upperBound)
+		if err != nil {
+			return nil, err
+		}
+		if serial.Sign() <= 0 {
+			continue
+		}
+		if serialOctets(serial) > maxSerialOctets {
+			continue
+		}
+		return serial, nil
+	}
+}
+
+// RandSerialLegacy generates a random serial number in [0, math.MaxInt64),
+// matching RandSerial's behavior before it was widened to 128 bits of
+// entropy.
+//
+// Deprecated: use RandSerial or RandSerialBits instead. RandSerialLegacy is
+// retained only for tests that pin the old, smaller serial size.
+func RandSerialLegacy() (*big.Int, error) {
+	return rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+}
+
+// serialOctets returns the number of octets serial's DER INTEGER content
+// would occupy, including the leading zero byte DER requires when the
+// most-significant bit of a positive integer's minimal representation is
+// set (to keep it from being read as negative).
+func serialOctets(serial *big.Int) int {
+	bytes := serial.Bytes()
+	if len(bytes) == 0 {
+		return 1
+	}
+	if bytes[0]&0x80 != 0 {
+		return len(bytes) + 1
+	}
+	return len(bytes)
+}
+
+// SerialSource generates certificate serial numbers for issuance. Logs
+// reject duplicate (issuer, serial) submissions, so implementations used
+// by a long-running monitor should track enough recent issuance history
+// to avoid accidental reuse.
+type SerialSource interface {
+	// NewSerial returns a serial number, or an error.
+	NewSerial() (*big.Int, error)
+}
+
+// SerialSourceFunc adapts a plain function to the SerialSource interface.
+type SerialSourceFunc func() (*big.Int, error)
+
+// NewSerial implements SerialSource.
+func (f SerialSourceFunc) NewSerial() (*big.Int, error) {
+	return f()
+}
+
+// LRUSerialSource is a SerialSource that draws serials with RandSerialBits
+// and remembers the most recently issued serials, redrawing on collision.
+type LRUSerialSource struct {
+	bits int
+	size int
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string
+}
+
+// NewLRUSerialSource creates an LRUSerialSource that draws serials with
+// defaultSerialBits bits of entropy and remembers up to size of the most
+// recently issued serials. If size is <= 0, defaultSerialLRUSize is used.
+func NewLRUSerialSource(size int) *LRUSerialSource {
+	if size <= 0 {
+		size = defaultSerialLRUSize
+	}
+	return &LRUSerialSource{
+		bits: defaultSerialBits,
+		size: size,
+		seen: make(map[string]struct{}, size),
+	}
+}
+
+// NewSerial implements SerialSource, redrawing serials until one that
+// isn't in the recently-issued LRU is found.
+func (s *LRUSerialSource) NewSerial() (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		serial, err := RandSerialBits(s.bits)
+		if err != nil {
+			return nil, err
+		}
+		key := serial.String()
+		if _, collision := s.seen[key]; collision {
+			continue
+		}
+		s.seen[key] = struct{}{}
+		s.order = append(s.order, key)
+		if len(s.order) > s.size {
+			oldest := s.order[0]
+			s.order = s.order[1:]
+			delete(s.seen, oldest)
+		}
+		return serial, nil
+	}
+}
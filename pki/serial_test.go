@@ -0,0 +1,113 @@
+package pki
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestRandSerialBitsWithinOctetLimit(t *testing.T) {
+	for _, bits := range []int{1, 8, 64, 128, 160} {
+		for i := 0; i < 50; i++ {
+			serial, err := RandSerialBits(bits)
+			if err != nil {
+				t.Fatalf("RandSerialBits(%d) returned error: %s", bits, err)
+			}
+			if serial.Sign() <= 0 {
+				t.Fatalf("RandSerialBits(%d) returned non-positive serial %s", bits, serial)
+			}
+			if octets := serialOctets(serial); octets > maxSerialOctets {
+				t.Fatalf("RandSerialBits(%d) returned serial %s needing %d DER octets, want <= %d", bits, serial, octets, maxSerialOctets)
+			}
+		}
+	}
+}
+
+func TestRandSerialLegacyRange(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		serial, err := RandSerialLegacy()
+		if err != nil {
+			t.Fatalf("RandSerialLegacy returned error: %s", err)
+		}
+		if serial.Sign() < 0 || serial.Cmp(big.NewInt(math.MaxInt64)) >= 0 {
+			t.Fatalf("RandSerialLegacy returned %s, want in [0, MaxInt64)", serial)
+		}
+	}
+}
+
+func TestLRUSerialSourceRetriesOnCollision(t *testing.T) {
+	// With bits == 2 there are only 3 possible positive serials (1, 2, 3),
+	// so seeding 2 of them into the LRU forces NewSerial to retry past
+	// collisions until it draws the one remaining free value.
+	src := &LRUSerialSource{
+		bits: 2,
+		size: defaultSerialLRUSize,
+		seen: map[string]struct{}{
+			"1": {},
+			"2": {},
+		},
+		order: []string{"1", "2"},
+	}
+
+	serial, err := src.NewSerial()
+	if err != nil {
+		t.Fatalf("NewSerial returned error: %s", err)
+	}
+	if serial.Cmp(big.NewInt(3)) != 0 {
+		t.Fatalf("expected NewSerial to retry past collisions and return 3, got %s", serial)
+	}
+	if _, ok := src.seen["3"]; !ok {
+		t.Fatal("expected the newly drawn serial to be recorded in seen")
+	}
+}
+
+func TestLRUSerialSourceEvictsOldest(t *testing.T) {
+	src := NewLRUSerialSource(2)
+	src.seen = map[string]struct{}{"a": {}, "b": {}}
+	src.order = []string{"a", "b"}
+
+	serial, err := src.NewSerial()
+	if err != nil {
+		t.Fatalf("NewSerial returned error: %s", err)
+	}
+
+	if len(src.seen) != 2 {
+		t.Fatalf("expected LRU to stay at size 2 after eviction, got %d entries", len(src.seen))
+	}
+	if _, ok := src.seen["a"]; ok {
+		t.Fatal("expected oldest entry \"a\" to be evicted")
+	}
+	if _, ok := src.seen["b"]; !ok {
+		t.Fatal("expected \"b\" to remain in the LRU")
+	}
+	if _, ok := src.seen[serial.String()]; !ok {
+		t.Fatal("expected the newly drawn serial to be recorded in the LRU")
+	}
+}
+
+func TestNewLRUSerialSourceDefaultSize(t *testing.T) {
+	src := NewLRUSerialSource(0)
+	if src.size != defaultSerialLRUSize {
+		t.Fatalf("expected size <= 0 to default to %d, got %d", defaultSerialLRUSize, src.size)
+	}
+	src = NewLRUSerialSource(5)
+	if src.size != 5 {
+		t.Fatalf("expected explicit size to be honored, got %d", src.size)
+	}
+}
+
+func TestLRUSerialSourceNoImmediateRepeats(t *testing.T) {
+	src := NewLRUSerialSource(1000)
+	seenAcrossDraws := make(map[string]struct{}, 500)
+	for i := 0; i < 500; i++ {
+		serial, err := src.NewSerial()
+		if err != nil {
+			t.Fatalf("NewSerial returned error: %s", err)
+		}
+		key := serial.String()
+		if _, dup := seenAcrossDraws[key]; dup {
+			t.Fatalf("NewSerial returned duplicate serial %s across %d draws", serial, i)
+		}
+		seenAcrossDraws[key] = struct{}{}
+	}
+}